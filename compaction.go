@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Compactor is implemented by backends that can bound their own log growth
+// by durably persisting a point-in-time snapshot of the store and
+// discarding events already reflected in it. Not every backend needs this
+// (MemoryTransactionLogger has nothing durable to compact).
+type Compactor interface {
+	Compact(ctx context.Context, sequence uint64, state map[string]string) error
+}
+
+// SnapshotLoader is implemented by backends that can recover a
+// previously-compacted starting state, so inizializeTransactionLogger can
+// load it before replaying whatever events remain in the log, instead of
+// replaying from the beginning of time.
+type SnapshotLoader interface {
+	LoadSnapshot(ctx context.Context) (sequence uint64, state map[string]string, ok bool, err error)
+}
+
+// Sizer is implemented by backends whose durable footprint can be checked
+// for the size-based compaction trigger.
+type Sizer interface {
+	Size() (int64, error)
+}
+
+// ErrCompactionUnsupported is returned by compact when the active backend
+// does not implement Compactor.
+var ErrCompactionUnsupported = fmt.Errorf("backend does not support compaction")
+
+// ErrCompactionNotLeader is returned by compact when this node is a
+// replicated-cluster replica rather than the leader.
+var ErrCompactionNotLeader = fmt.Errorf("only the cluster leader can compact")
+
+// compact snapshots the current store and hands it to the active logger's
+// Compactor, which persists it and drops events it already covers. It uses
+// snapshotForCompaction rather than the client-facing NewSnapshot: compact
+// runs on every tick of the background loop (and on every admin request),
+// so pinning a client-visible snapshot per call would keep another full
+// copy of the store in the snapshots map for snapshotTTL on every
+// compaction.
+//
+// On a replicated cluster, only the leader's logger.LastSequence() tracks
+// ordinary write traffic: a replica only ever mutates its store via
+// applyPut/applyDelete from applyNewEvents, which never advances it, so a
+// replica's LastSequence only moves when catchUpFromSnapshot raises it to
+// the last compacted sequence. Compacting from a replica would pair that
+// stale sequence with state that's actually caught up to much later
+// events, so refuse outright unless this node is the leader (or isn't
+// part of a replicated cluster at all).
+func compact(ctx context.Context) error {
+	if replica != nil && !replica.IsLeader() {
+		return ErrCompactionNotLeader
+	}
+
+	compactor, ok := logger.(Compactor)
+	if !ok {
+		return ErrCompactionUnsupported
+	}
+
+	sequence, state := snapshotForCompaction()
+	return compactor.Compact(ctx, sequence, state)
+}
+
+// startCompactionLoop runs compact on a timer. If maxSize is positive, each
+// tick only compacts once the backend's Sizer reports at least maxSize
+// bytes; interval <= 0 disables the loop entirely, whatever maxSize is.
+func startCompactionLoop(ctx context.Context, interval time.Duration, maxSize int64) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if maxSize > 0 {
+					sizer, ok := logger.(Sizer)
+					if !ok {
+						continue
+					}
+					size, err := sizer.Size()
+					if err != nil || size < maxSize {
+						continue
+					}
+				}
+				if err := compact(ctx); err != nil && err != ErrCompactionUnsupported && err != ErrCompactionNotLeader {
+					log.Printf("background compaction failed: %v", err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// adminCompactHandler lets an operator trigger compaction on demand
+// instead of waiting for the background ticker.
+func adminCompactHandler(w http.ResponseWriter, r *http.Request) {
+	if err := compact(r.Context()); err != nil {
+		status := http.StatusInternalServerError
+		switch err {
+		case ErrCompactionUnsupported:
+			status = http.StatusNotImplemented
+		case ErrCompactionNotLeader:
+			status = http.StatusServiceUnavailable
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// storeSnapshot is the gob-encoded payload file-based compaction writes to
+// snapshot-<seq>.gob: the sequence of the last event it reflects, plus the
+// store contents at that point.
+type storeSnapshot struct {
+	Sequence uint64
+	State    map[string]string
+}
+
+func encodeSnapshotState(state map[string]string) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(state); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decodeSnapshotState(data []byte) (map[string]string, error) {
+	var state map[string]string
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+const (
+	snapshotFilePrefix = "snapshot-"
+	snapshotFileSuffix = ".gob"
+)
+
+func snapshotFileName(sequence uint64) string {
+	return fmt.Sprintf("%s%d%s", snapshotFilePrefix, sequence, snapshotFileSuffix)
+}
+
+// writeSnapshotFile gob-encodes a storeSnapshot to snapshot-<seq>.gob in
+// dir. It writes to a temp file and renames it into place so a crash
+// mid-write can't leave latestSnapshotFile/loadSnapshotFile a half-written
+// snapshot to trip over.
+func writeSnapshotFile(dir string, sequence uint64, state map[string]string) (string, error) {
+	path := filepath.Join(dir, snapshotFileName(sequence))
+	tmp := path + ".tmp"
+
+	f, err := os.Create(tmp)
+	if err != nil {
+		return "", fmt.Errorf("cannot create snapshot temp file: %w", err)
+	}
+	if err := gob.NewEncoder(f).Encode(storeSnapshot{Sequence: sequence, State: state}); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return "", fmt.Errorf("cannot encode snapshot: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return "", fmt.Errorf("cannot close snapshot temp file: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return "", fmt.Errorf("cannot install snapshot file: %w", err)
+	}
+	return path, nil
+}
+
+// latestSnapshotFile finds the snapshot-<seq>.gob file in dir with the
+// highest sequence.
+func latestSnapshotFile(dir string) (path string, sequence uint64, ok bool) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", 0, false
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, snapshotFilePrefix) || !strings.HasSuffix(name, snapshotFileSuffix) {
+			continue
+		}
+		seqStr := strings.TrimSuffix(strings.TrimPrefix(name, snapshotFilePrefix), snapshotFileSuffix)
+		seq, err := strconv.ParseUint(seqStr, 10, 64)
+		if err != nil {
+			continue
+		}
+		if !ok || seq > sequence {
+			sequence, path, ok = seq, filepath.Join(dir, name), true
+		}
+	}
+	return path, sequence, ok
+}
+
+func loadSnapshotFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var snap storeSnapshot
+	if err := gob.NewDecoder(f).Decode(&snap); err != nil {
+		return nil, err
+	}
+	return snap.State, nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// ///HANDLERS//////////
+func keyValuePutHandler(w http.ResponseWriter, r *http.Request) {
+	// In a replicated cluster, only the node holding the writer advisory
+	// lock may accept writes; everyone else just applies what it reads
+	// back from NOTIFY.
+	if replica != nil && !replica.IsLeader() {
+		http.Error(w, "this node is not the cluster writer", http.StatusServiceUnavailable)
+		return
+	}
+
+	vars := mux.Vars(r)
+	key := vars["key"]
+
+	value, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = Put(key, string(value))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	logger.WritePut(key, string(value))
+
+	w.WriteHeader(http.StatusCreated)
+}
+
+func keyValueGetHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	key := vars["key"]
+
+	value, err := Get(key)
+	if err == ErrorNoSuchKey {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(value))
+}
+
+type keysListResponse struct {
+	SnapshotID string   `json:"snapshot_id"`
+	Keys       []string `json:"keys"`
+}
+
+// keysListHandler takes a fresh snapshot of the store and returns the keys
+// matching the optional "prefix" query parameter, along with the snapshot
+// id a client can use with snapshotKeyGetHandler to keep reading a
+// consistent view while it pages through the results.
+func keysListHandler(w http.ResponseWriter, r *http.Request) {
+	prefix := r.URL.Query().Get("prefix")
+
+	snap := NewSnapshot()
+	resp := keysListResponse{
+		SnapshotID: snap.id,
+		Keys:       snap.Keys(prefix),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func snapshotKeyGetHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	snap, err := GetSnapshotByID(vars["id"])
+	if err == ErrorNoSuchSnapshot {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	value, err := snap.Get(vars["key"])
+	if err == ErrorNoSuchKey {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(value))
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+///// Event /////
+
+type Event struct {
+	Sequence  uint64
+	EventType EventType
+	Key       string
+	Value     string
+}
+
+type EventType byte
+
+const (
+	_ = iota
+	EventDelete
+	EventPut
+)
+
+//////TransactionLogger/////
+
+type TransactionLogger interface {
+	WriteDelete(key string)
+	WritePut(key, value string)
+	Err() <-chan error
+	Run()
+	ReadEvents() (<-chan Event, <-chan error)
+	// Close drains any buffered events, durably persists them, and releases
+	// the underlying resource. It blocks until the writer goroutine has
+	// exited or ctx is done, whichever comes first.
+	Close(ctx context.Context) error
+	// LastSequence returns the highest event sequence this logger has
+	// observed, whether from replaying its log at startup or from writes
+	// since. The compaction subsystem uses it to know which events a new
+	// snapshot makes safe to discard.
+	LastSequence() uint64
+}
+
+// LoggerFactory opens a TransactionLogger backed by dsn, creating and
+// migrating its schema if necessary. dsn is whatever remains of a
+// --backend/CLOUDGO_BACKEND value after the "<driver>://" prefix has been
+// stripped (e.g. a file path, or a database connection string).
+type LoggerFactory func(dsn string) (TransactionLogger, error)
+
+var (
+	loggerDriversMu sync.Mutex
+	loggerDrivers   = make(map[string]LoggerFactory)
+)
+
+// RegisterLogger makes a TransactionLogger driver available under name for
+// selection via --backend/CLOUDGO_BACKEND. It is meant to be called from a
+// driver's init(), mirroring database/sql.Register, and panics if name is
+// already registered.
+func RegisterLogger(name string, factory LoggerFactory) {
+	loggerDriversMu.Lock()
+	defer loggerDriversMu.Unlock()
+
+	if factory == nil {
+		panic("cloudgo: RegisterLogger factory is nil")
+	}
+	if _, dup := loggerDrivers[name]; dup {
+		panic("cloudgo: RegisterLogger called twice for driver " + name)
+	}
+	loggerDrivers[name] = factory
+}
+
+// OpenLogger constructs the named driver's TransactionLogger from dsn.
+func OpenLogger(name, dsn string) (TransactionLogger, error) {
+	loggerDriversMu.Lock()
+	factory, ok := loggerDrivers[name]
+	loggerDriversMu.Unlock()
+
+	if !ok {
+		return nil, fmt.Errorf("cloudgo: unknown backend %q (forgotten import?)", name)
+	}
+	return factory(dsn)
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+)
+
+func init() {
+	RegisterLogger("file", func(dsn string) (TransactionLogger, error) {
+		return NewFileTransactionLogger(dsn)
+	})
+}
+
+/////FileTransactionLogger/////
+
+type FileTransactionLogger struct {
+	events       chan<- Event
+	errors       <-chan error
+	done         chan struct{}
+	lastSequence uint64
+
+	// fileMu guards file: it serializes the writer goroutine's appends
+	// (Run) against Compact's rewrite-and-swap, and against any other
+	// access to file once compaction can replace it with a new handle.
+	fileMu sync.Mutex
+	file   *os.File
+}
+
+func (l *FileTransactionLogger) WriteDelete(key string) {
+	l.events <- Event{EventType: EventDelete, Key: key}
+}
+
+func (l *FileTransactionLogger) WritePut(key, value string) {
+	l.events <- Event{EventType: EventPut, Key: key, Value: value}
+}
+
+func (l *FileTransactionLogger) Err() <-chan error {
+	return l.errors
+}
+
+func (l *FileTransactionLogger) LastSequence() uint64 {
+	return atomic.LoadUint64(&l.lastSequence)
+}
+
+func NewFileTransactionLogger(fileName string) (TransactionLogger, error) {
+	file, err := os.OpenFile(fileName, os.O_CREATE|os.O_APPEND|os.O_RDWR, os.ModePerm)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open transaction log file: %w", err)
+	}
+	///TODO:: проверить дескриптор файла
+	return &FileTransactionLogger{file: file}, nil
+}
+
+func (l *FileTransactionLogger) Run() {
+	events := make(chan Event, 16)
+	errors := make(chan error, 1)
+	done := make(chan struct{})
+	l.events = events
+	l.errors = errors
+	l.done = done
+
+	go func() {
+		defer close(done)
+		for e := range events {
+			seq := atomic.AddUint64(&l.lastSequence, 1)
+
+			l.fileMu.Lock()
+			_, err := fmt.Fprintf(l.file, "%d\t%d\t%s\t%s\n", seq, e.EventType, e.Key, e.Value)
+			l.fileMu.Unlock()
+			if err != nil {
+				errors <- err
+				return
+			}
+		}
+	}()
+}
+
+// Close stops accepting new events, waits for the writer goroutine to drain
+// them, fsyncs the transaction log to disk, and closes the file. It returns
+// early with ctx.Err() if ctx is done before the drain completes.
+func (l *FileTransactionLogger) Close(ctx context.Context) error {
+	close(l.events)
+
+	select {
+	case <-l.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	l.fileMu.Lock()
+	defer l.fileMu.Unlock()
+
+	if err := l.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync transaction log: %w", err)
+	}
+	return l.file.Close()
+}
+
+func (l *FileTransactionLogger) ReadEvents() (<-chan Event, <-chan error) {
+	scanner := bufio.NewScanner(l.file)
+	outEvent := make(chan Event)
+	outError := make(chan error, 1)
+
+	go func() {
+		var e Event
+		defer close(outEvent)
+		defer close(outError)
+
+		for scanner.Scan() {
+			line := scanner.Text()
+			if line == io.EOF.Error() {
+				continue
+			}
+			_, err := fmt.Sscanf(line, "%d\t%d\t%s\t%v", &e.Sequence, &e.EventType, &e.Key, &e.Value)
+
+			if err != nil {
+				outError <- fmt.Errorf("input parse error %q: %w", line, err)
+				return
+			}
+
+			if atomic.LoadUint64(&l.lastSequence) >= e.Sequence {
+				outError <- fmt.Errorf("input parse error %q: sequence not increasing", line)
+				return
+			}
+			atomic.StoreUint64(&l.lastSequence, e.Sequence)
+
+			outEvent <- e
+		}
+		if err := scanner.Err(); err != nil {
+			outError <- fmt.Errorf("transaction log read failure: %w", err)
+			return
+
+		}
+	}()
+	return outEvent, outError
+}
+
+// LoadSnapshot returns the most recently compacted state for this log
+// file's directory, if any compaction has ever run.
+func (l *FileTransactionLogger) LoadSnapshot(ctx context.Context) (uint64, map[string]string, bool, error) {
+	l.fileMu.Lock()
+	dir := filepath.Dir(l.file.Name())
+	l.fileMu.Unlock()
+
+	path, sequence, ok := latestSnapshotFile(dir)
+	if !ok {
+		return 0, nil, false, nil
+	}
+
+	state, err := loadSnapshotFile(path)
+	if err != nil {
+		return 0, nil, false, fmt.Errorf("cannot load snapshot %s: %w", path, err)
+	}
+
+	atomic.StoreUint64(&l.lastSequence, sequence)
+	return sequence, state, true, nil
+}
+
+// Compact writes state to a new snapshot-<sequence>.gob file, then rewrites
+// the transaction log to keep only events with Sequence > sequence,
+// instead of truncating it outright. A concurrent Put can mutate store.m
+// (and so already be reflected by a later snapshot) before its event has
+// reached the file; snapshotForCompaction (store.go) guarantees any event
+// that lands after the clone gets a sequence strictly greater than the one
+// passed here, so keeping everything above the cutover - rather than
+// wiping the file - can never drop an event the snapshot doesn't already
+// cover. The rewrite is done under fileMu, the same lock Run's writer
+// goroutine takes for each append, so no write can land mid-rewrite; the
+// new log is built in a temp file and renamed into place, then file is
+// reopened, since a rename doesn't repoint an already-open descriptor at
+// the new inode.
+func (l *FileTransactionLogger) Compact(ctx context.Context, sequence uint64, state map[string]string) error {
+	l.fileMu.Lock()
+	defer l.fileMu.Unlock()
+
+	path := l.file.Name()
+	dir := filepath.Dir(path)
+
+	if _, err := writeSnapshotFile(dir, sequence, state); err != nil {
+		return err
+	}
+
+	tmpPath := path + ".compact.tmp"
+
+	if _, err := l.file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("cannot rewind transaction log for compaction: %w", err)
+	}
+
+	out, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("cannot create compacted log temp file: %w", err)
+	}
+
+	var e Event
+	scanner := bufio.NewScanner(l.file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if _, err := fmt.Sscanf(line, "%d\t%d\t%s\t%v", &e.Sequence, &e.EventType, &e.Key, &e.Value); err != nil {
+			out.Close()
+			os.Remove(tmpPath)
+			return fmt.Errorf("cannot parse transaction log line %q during compaction: %w", line, err)
+		}
+		if e.Sequence <= sequence {
+			continue
+		}
+		if _, err := fmt.Fprintf(out, "%d\t%d\t%s\t%s\n", e.Sequence, e.EventType, e.Key, e.Value); err != nil {
+			out.Close()
+			os.Remove(tmpPath)
+			return fmt.Errorf("cannot write compacted log entry: %w", err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		out.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("cannot read transaction log during compaction: %w", err)
+	}
+
+	if err := out.Sync(); err != nil {
+		out.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("cannot sync compacted log: %w", err)
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("cannot close compacted log: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("cannot install compacted log: %w", err)
+	}
+
+	reopened, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_RDWR, os.ModePerm)
+	if err != nil {
+		return fmt.Errorf("cannot reopen transaction log after compaction: %w", err)
+	}
+	old := l.file
+	l.file = reopened
+	return old.Close()
+}
+
+// Size reports the transaction log's current size in bytes, for the
+// size-based compaction trigger.
+func (l *FileTransactionLogger) Size() (int64, error) {
+	l.fileMu.Lock()
+	defer l.fileMu.Unlock()
+
+	info, err := l.file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
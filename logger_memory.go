@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+func init() {
+	RegisterLogger("memory", func(dsn string) (TransactionLogger, error) {
+		return NewMemoryTransactionLogger(), nil
+	})
+}
+
+// MemoryTransactionLogger keeps events in a process-local slice instead of
+// writing them anywhere durable. It exists for tests and local
+// experimentation where losing the log on restart is acceptable; dsn is
+// ignored.
+type MemoryTransactionLogger struct {
+	events       chan<- Event
+	errors       <-chan error
+	done         chan struct{}
+	mu           sync.Mutex
+	lastSequence uint64
+	log          []Event
+}
+
+func NewMemoryTransactionLogger() *MemoryTransactionLogger {
+	return &MemoryTransactionLogger{}
+}
+
+func (l *MemoryTransactionLogger) WriteDelete(key string) {
+	l.events <- Event{EventType: EventDelete, Key: key}
+}
+
+func (l *MemoryTransactionLogger) WritePut(key, value string) {
+	l.events <- Event{EventType: EventPut, Key: key, Value: value}
+}
+
+func (l *MemoryTransactionLogger) Err() <-chan error {
+	return l.errors
+}
+
+func (l *MemoryTransactionLogger) LastSequence() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.lastSequence
+}
+
+func (l *MemoryTransactionLogger) Run() {
+	events := make(chan Event, 16)
+	errors := make(chan error, 1)
+	done := make(chan struct{})
+	l.events = events
+	l.errors = errors
+	l.done = done
+
+	go func() {
+		defer close(done)
+		for e := range events {
+			l.mu.Lock()
+			l.lastSequence++
+			e.Sequence = l.lastSequence
+			l.log = append(l.log, e)
+			l.mu.Unlock()
+		}
+	}()
+}
+
+func (l *MemoryTransactionLogger) Close(ctx context.Context) error {
+	close(l.events)
+
+	select {
+	case <-l.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l *MemoryTransactionLogger) ReadEvents() (<-chan Event, <-chan error) {
+	outEvent := make(chan Event)
+	outError := make(chan error, 1)
+
+	go func() {
+		defer close(outEvent)
+		defer close(outError)
+
+		l.mu.Lock()
+		events := append([]Event(nil), l.log...)
+		l.mu.Unlock()
+
+		for _, e := range events {
+			outEvent <- e
+		}
+	}()
+	return outEvent, outError
+}
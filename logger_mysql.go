@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync/atomic"
+
+	_ "github.com/go-sql-driver/mysql"
+)
+
+func init() {
+	RegisterLogger("mysql", func(dsn string) (TransactionLogger, error) {
+		return newMySQLTransactionLogger(dsn)
+	})
+}
+
+var mysqlMigrations = []migration{
+	{version: 1, sql: `
+		CREATE TABLE IF NOT EXISTS events (
+			sequence BIGINT AUTO_INCREMENT PRIMARY KEY,
+			event_type TINYINT NOT NULL,
+			key_name VARCHAR(512) NOT NULL,
+			value TEXT
+		)
+	`},
+}
+
+const mysqlCreateMigrationsTable = `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY
+	)
+`
+const mysqlInsertMigration = `INSERT INTO schema_migrations (version) VALUES (?)`
+
+type MySQLTransactionLogger struct {
+	events       chan<- Event
+	errors       <-chan error
+	done         chan struct{}
+	lastSequence uint64
+	db           *sql.DB
+}
+
+func (l *MySQLTransactionLogger) WriteDelete(key string) {
+	l.events <- Event{EventType: EventDelete, Key: key}
+}
+
+func (l *MySQLTransactionLogger) WritePut(key, value string) {
+	l.events <- Event{EventType: EventPut, Key: key, Value: value}
+}
+
+func (l *MySQLTransactionLogger) Err() <-chan error {
+	return l.errors
+}
+
+func (l *MySQLTransactionLogger) LastSequence() uint64 {
+	return atomic.LoadUint64(&l.lastSequence)
+}
+
+func (l *MySQLTransactionLogger) Run() {
+	events := make(chan Event, 16)
+	errors := make(chan error, 1)
+	done := make(chan struct{})
+	l.events = events
+	l.errors = errors
+	l.done = done
+
+	go func() {
+		defer close(done)
+		query := `INSERT INTO events (event_type, key_name, value) VALUES (?, ?, ?)`
+		for e := range events {
+			res, err := l.db.Exec(query, e.EventType, e.Key, e.Value)
+			if err != nil {
+				errors <- err
+				return
+			}
+			if seq, err := res.LastInsertId(); err == nil {
+				atomic.StoreUint64(&l.lastSequence, uint64(seq))
+			}
+		}
+	}()
+}
+
+func (l *MySQLTransactionLogger) Close(ctx context.Context) error {
+	close(l.events)
+
+	select {
+	case <-l.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	return l.db.Close()
+}
+
+func (l *MySQLTransactionLogger) ReadEvents() (<-chan Event, <-chan error) {
+	outEvent := make(chan Event)
+	outError := make(chan error, 1)
+
+	go func() {
+		defer close(outEvent)
+		defer close(outError)
+		rows, err := l.db.Query(`SELECT sequence, event_type, key_name, value FROM events ORDER BY sequence`)
+		if err != nil {
+			outError <- fmt.Errorf("sql query error: %w", err)
+			return
+		}
+		defer rows.Close()
+
+		var e Event
+		for rows.Next() {
+			if err := rows.Scan(&e.Sequence, &e.EventType, &e.Key, &e.Value); err != nil {
+				outError <- fmt.Errorf("error reading row: %w", err)
+				return
+			}
+			atomic.StoreUint64(&l.lastSequence, e.Sequence)
+			outEvent <- e
+		}
+		if err := rows.Err(); err != nil {
+			outError <- fmt.Errorf("transaction log read failure: %w", err)
+			return
+		}
+	}()
+	return outEvent, outError
+}
+
+func newMySQLTransactionLogger(dsn string) (TransactionLogger, error) {
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open db: %w", err)
+	}
+
+	if err := db.Ping(); err != nil {
+		return nil, fmt.Errorf("failed to open db connection: %w", err)
+	}
+
+	if err := applyMigrations(db, mysqlCreateMigrationsTable, mysqlInsertMigration, mysqlMigrations); err != nil {
+		return nil, fmt.Errorf("cannot migrate events schema: %w", err)
+	}
+
+	return &MySQLTransactionLogger{db: db}, nil
+}
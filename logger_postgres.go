@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+func init() {
+	RegisterLogger("postgres", func(dsn string) (TransactionLogger, error) {
+		return newPostgresTransactionLogger("postgres://" + dsn)
+	})
+}
+
+// Batch settings for PostgresTransactionLogger.Run: events are accumulated
+// and flushed either once postgresBatchSize events are pending or every
+// postgresBatchInterval, whichever happens first.
+const (
+	postgresBatchSize     = 16
+	postgresBatchInterval = 100 * time.Millisecond
+)
+
+var postgresMigrations = []migration{
+	{version: 1, sql: `
+		CREATE TABLE IF NOT EXISTS events (
+			sequence SERIAL PRIMARY KEY,
+			event_type SMALLINT NOT NULL,
+			key TEXT NOT NULL,
+			value TEXT
+		)
+	`},
+}
+
+const postgresCreateMigrationsTable = `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY
+	)
+`
+const postgresInsertMigration = `INSERT INTO schema_migrations (version) VALUES ($1)`
+
+const postgresCreateSnapshotsTable = `
+	CREATE TABLE IF NOT EXISTS snapshots (
+		sequence BIGINT PRIMARY KEY,
+		state BYTEA NOT NULL
+	)
+`
+
+type PostgresTransactionLogger struct {
+	events       chan<- Event
+	errors       <-chan error
+	done         chan struct{}
+	lastSequence uint64
+	db           *sql.DB
+}
+
+func (l *PostgresTransactionLogger) WriteDelete(key string) {
+	l.events <- Event{EventType: EventDelete, Key: key}
+}
+
+func (l *PostgresTransactionLogger) WritePut(key, value string) {
+	l.events <- Event{EventType: EventPut, Key: key, Value: value}
+}
+
+func (l *PostgresTransactionLogger) Err() <-chan error {
+	return l.errors
+}
+
+func (l *PostgresTransactionLogger) LastSequence() uint64 {
+	return atomic.LoadUint64(&l.lastSequence)
+}
+
+func (l *PostgresTransactionLogger) Run() {
+	events := make(chan Event, 16)
+	errors := make(chan error, 1)
+	done := make(chan struct{})
+	l.events = events
+	l.errors = errors
+	l.done = done
+
+	go func() {
+		defer close(done)
+
+		query := `INSERT INTO events (event_type, key, value) VALUES ($1, $2, $3) RETURNING sequence`
+		batch := make([]Event, 0, postgresBatchSize)
+
+		flush := func() error {
+			if len(batch) == 0 {
+				return nil
+			}
+			tx, err := l.db.Begin()
+			if err != nil {
+				return fmt.Errorf("failed to begin batch transaction: %w", err)
+			}
+			var lastSeq uint64
+			for _, e := range batch {
+				if err := tx.QueryRow(query, e.EventType, e.Key, e.Value).Scan(&lastSeq); err != nil {
+					tx.Rollback()
+					return fmt.Errorf("failed to insert event: %w", err)
+				}
+			}
+			// Notify any replicas from inside the same transaction that
+			// inserted the events, so a replica that wakes up on this
+			// NOTIFY is guaranteed to see the rows once it queries.
+			if _, err := tx.Exec(`SELECT pg_notify($1, $2)`, notifyChannel, strconv.FormatUint(lastSeq, 10)); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("failed to notify replicas: %w", err)
+			}
+			if err := tx.Commit(); err != nil {
+				return fmt.Errorf("failed to commit batch: %w", err)
+			}
+			atomic.StoreUint64(&l.lastSequence, lastSeq)
+			batch = batch[:0]
+			return nil
+		}
+
+		ticker := time.NewTicker(postgresBatchInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case e, ok := <-events:
+				if !ok {
+					if err := flush(); err != nil {
+						errors <- err
+					}
+					return
+				}
+				batch = append(batch, e)
+				if len(batch) >= postgresBatchSize {
+					if err := flush(); err != nil {
+						errors <- err
+						return
+					}
+				}
+			case <-ticker.C:
+				if err := flush(); err != nil {
+					errors <- err
+					return
+				}
+			}
+		}
+	}()
+}
+
+// Close stops accepting new events, flushes any pending batch inside its own
+// commit, and closes the database connection. It blocks until the writer
+// goroutine exits or ctx is done.
+func (l *PostgresTransactionLogger) Close(ctx context.Context) error {
+	close(l.events)
+
+	select {
+	case <-l.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	return l.db.Close()
+}
+
+func (l *PostgresTransactionLogger) ReadEvents() (<-chan Event, <-chan error) {
+	outEvent := make(chan Event)
+	outError := make(chan error, 1)
+
+	go func() {
+		defer close(outEvent)
+		defer close(outError)
+		query := `SELECT sequence, event_type, key, value FROM events ORDER BY sequence`
+		rows, err := l.db.Query(query)
+		if err != nil {
+			outError <- fmt.Errorf("sql query error: %w", err)
+			return
+		}
+		defer rows.Close()
+
+		var e Event
+		for rows.Next() {
+			err := rows.Scan(&e.Sequence, &e.EventType, &e.Key, &e.Value)
+			if err != nil {
+				outError <- fmt.Errorf("error reading row: %w", err)
+				return
+			}
+			atomic.StoreUint64(&l.lastSequence, e.Sequence)
+			outEvent <- e
+		}
+		if err = rows.Err(); err != nil {
+			outError <- fmt.Errorf("transaction log read failure: %w", err)
+			return
+		}
+	}()
+	return outEvent, outError
+}
+
+// LoadSnapshot returns the most recent row from the snapshots table, if
+// compaction has ever run. A missing snapshots table (no compaction has
+// ever happened yet) is treated the same as no snapshot, not an error.
+func (l *PostgresTransactionLogger) LoadSnapshot(ctx context.Context) (uint64, map[string]string, bool, error) {
+	var sequence uint64
+	var encoded []byte
+	query := `SELECT sequence, state FROM snapshots ORDER BY sequence DESC LIMIT 1`
+	if err := l.db.QueryRowContext(ctx, query).Scan(&sequence, &encoded); err != nil {
+		return 0, nil, false, nil
+	}
+
+	state, err := decodeSnapshotState(encoded)
+	if err != nil {
+		return 0, nil, false, fmt.Errorf("cannot decode snapshot: %w", err)
+	}
+
+	// Only ever raise lastSequence: catchUpFromSnapshot calls this on every
+	// replication pass, including on the leader, whose committed writes are
+	// usually already past the latest snapshot.
+	for {
+		current := atomic.LoadUint64(&l.lastSequence)
+		if sequence <= current || atomic.CompareAndSwapUint64(&l.lastSequence, current, sequence) {
+			break
+		}
+	}
+	return sequence, state, true, nil
+}
+
+// Compact writes state and sequence into a new snapshots row and deletes
+// the events it already covers, all inside one transaction so a crash
+// mid-compaction can't leave the snapshot without the truncation (or vice
+// versa).
+func (l *PostgresTransactionLogger) Compact(ctx context.Context, sequence uint64, state map[string]string) error {
+	encoded, err := encodeSnapshotState(state)
+	if err != nil {
+		return fmt.Errorf("cannot encode snapshot: %w", err)
+	}
+
+	tx, err := l.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("cannot begin compaction transaction: %w", err)
+	}
+
+	if _, err := tx.Exec(postgresCreateSnapshotsTable); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("cannot create snapshots table: %w", err)
+	}
+	if _, err := tx.Exec(`INSERT INTO snapshots (sequence, state) VALUES ($1, $2)`, sequence, encoded); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("cannot write snapshot row: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM events WHERE sequence <= $1`, sequence); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("cannot drop compacted events: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+func newPostgresTransactionLogger(dsn string) (TransactionLogger, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open db: %w", err)
+	}
+
+	if err = db.Ping(); err != nil {
+		return nil, fmt.Errorf("failed to open db connection: %w", err)
+	}
+
+	if err := applyMigrations(db, postgresCreateMigrationsTable, postgresInsertMigration, postgresMigrations); err != nil {
+		return nil, fmt.Errorf("cannot migrate events schema: %w", err)
+	}
+
+	return &PostgresTransactionLogger{db: db}, nil
+}
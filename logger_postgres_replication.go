@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// notifyChannel is the Postgres NOTIFY channel cloudgo nodes listen on for
+// new events; the payload is the sequence of the last row inserted by the
+// batch that sent it. It's only a hint to wake up promptly - applyNewEvents always
+// re-queries by sequence, so a missed or coalesced notification is never
+// lost, just noticed a little later.
+const notifyChannel = "cloudgo_events"
+
+// writerLockID is the pg_try_advisory_lock key cloudgo nodes contend for
+// to become a replicated cluster's single writer. Arbitrary but fixed, so
+// every node in a cluster races for the same lock.
+const writerLockID = 747274
+
+// replica is non-nil when this node joined a replicated cluster via
+// --replicate; handlers consult replica.IsLeader to decide whether to
+// accept writes locally.
+var replica *PostgresReplica
+
+// PostgresReplica turns a PostgresTransactionLogger into one node of a
+// replicated cluster: it listens for NOTIFY cloudgo_events and applies new
+// rows to the local in-memory store as they land, and periodically
+// contends for the pg_try_advisory_lock that designates the cluster's
+// single writer.
+type PostgresReplica struct {
+	logger      *PostgresTransactionLogger
+	isLeader    int32 // atomic bool; kept in sync with leaderConn under leaderMu
+	lastApplied uint64
+
+	leaderMu   sync.Mutex
+	leaderConn *sql.Conn // held only while this node is leader; see tryBecomeLeader
+}
+
+// NewPostgresReplica wraps logger with replication bookkeeping. Call Run
+// to start listening and contending for leadership.
+func NewPostgresReplica(logger *PostgresTransactionLogger) *PostgresReplica {
+	return &PostgresReplica{logger: logger}
+}
+
+// IsLeader reports whether this node currently holds the writer advisory
+// lock.
+func (r *PostgresReplica) IsLeader() bool {
+	return atomic.LoadInt32(&r.isLeader) == 1
+}
+
+// Run starts the replication listener and leader-election loop. It blocks
+// until ctx is done.
+func (r *PostgresReplica) Run(ctx context.Context, dsn string) error {
+	listener := pq.NewListener(dsn, 10*time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("replication listener: %v", err)
+		}
+	})
+	defer listener.Close()
+	defer r.releaseLeadership()
+
+	if err := listener.Listen(notifyChannel); err != nil {
+		return fmt.Errorf("cannot listen on %s: %w", notifyChannel, err)
+	}
+
+	if err := r.applyNewEvents(ctx); err != nil {
+		log.Printf("initial replication catch-up failed: %v", err)
+	}
+	r.tryBecomeLeader(ctx)
+
+	electionTicker := time.NewTicker(5 * time.Second)
+	defer electionTicker.Stop()
+
+	// pq.Listener reconnects silently on a dropped connection; a periodic
+	// poll catches any NOTIFY that landed during a reconnect window.
+	pollTicker := time.NewTicker(90 * time.Second)
+	defer pollTicker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-listener.Notify:
+			if err := r.applyNewEvents(ctx); err != nil {
+				log.Printf("replication apply failed: %v", err)
+			}
+		case <-pollTicker.C:
+			if err := r.applyNewEvents(ctx); err != nil {
+				log.Printf("replication apply failed: %v", err)
+			}
+		case <-electionTicker.C:
+			r.tryBecomeLeader(ctx)
+		}
+	}
+}
+
+// tryBecomeLeader attempts to take the writer advisory lock. pg_try_advisory_lock
+// is scoped to the physical session that calls it, so it's acquired and
+// held on a single *sql.Conn checked out of r.logger.db for as long as
+// this node believes it's leader, rather than through the pooled *sql.DB:
+// a query run through the pool can land on any connection, and the pool
+// is free to silently close or recycle the one actually holding the lock
+// (idle timeout, eviction) without the app ever finding out, leaving a
+// node believing it's leader with no lock behind that belief at all.
+//
+// If this node already holds leaderConn, it's reconfirmed with a ping
+// rather than re-acquired: once that connection dies, Postgres has
+// already released the lock on its end, so isLeader is demoted in lock
+// step with the connection instead of staying true forever.
+func (r *PostgresReplica) tryBecomeLeader(ctx context.Context) {
+	r.leaderMu.Lock()
+	defer r.leaderMu.Unlock()
+
+	if r.leaderConn != nil {
+		if err := r.leaderConn.PingContext(ctx); err == nil {
+			return
+		}
+		log.Printf("lost writer connection, demoting from cluster leader")
+		r.leaderConn.Close()
+		r.leaderConn = nil
+		atomic.StoreInt32(&r.isLeader, 0)
+	}
+
+	conn, err := r.logger.db.Conn(ctx)
+	if err != nil {
+		log.Printf("leader election check failed: %v", err)
+		return
+	}
+
+	var acquired bool
+	query := `SELECT pg_try_advisory_lock($1)`
+	if err := conn.QueryRowContext(ctx, query, writerLockID).Scan(&acquired); err != nil {
+		log.Printf("leader election check failed: %v", err)
+		conn.Close()
+		return
+	}
+	if !acquired {
+		conn.Close()
+		return
+	}
+
+	log.Printf("acquired writer lock %d, promoting to cluster leader", writerLockID)
+	r.leaderConn = conn
+	atomic.StoreInt32(&r.isLeader, 1)
+}
+
+// releaseLeadership closes the dedicated leadership connection, if any,
+// which drops the advisory lock on the Postgres side, and clears isLeader
+// to match.
+func (r *PostgresReplica) releaseLeadership() {
+	r.leaderMu.Lock()
+	defer r.leaderMu.Unlock()
+
+	if r.leaderConn != nil {
+		r.leaderConn.Close()
+		r.leaderConn = nil
+	}
+	atomic.StoreInt32(&r.isLeader, 0)
+}
+
+// applyNewEvents pulls every event past lastApplied and applies it to the
+// local store directly via applyPut/applyDelete, bypassing the
+// transaction-log write that Delete and the PUT handler make, so a replica
+// never re-logs an event it is only
+// replaying - each row would otherwise retrigger NOTIFY and get replayed
+// by every other node forever.
+func (r *PostgresReplica) applyNewEvents(ctx context.Context) error {
+	if err := r.catchUpFromSnapshot(ctx); err != nil {
+		return err
+	}
+
+	query := `SELECT sequence, event_type, key, value FROM events WHERE sequence > $1 ORDER BY sequence`
+	rows, err := r.logger.db.QueryContext(ctx, query, atomic.LoadUint64(&r.lastApplied))
+	if err != nil {
+		return fmt.Errorf("cannot query new events: %w", err)
+	}
+	defer rows.Close()
+
+	var e Event
+	for rows.Next() {
+		if err := rows.Scan(&e.Sequence, &e.EventType, &e.Key, &e.Value); err != nil {
+			return fmt.Errorf("cannot scan replicated event: %w", err)
+		}
+
+		switch e.EventType {
+		case EventPut:
+			if err := applyPut(e.Key, e.Value); err != nil {
+				return fmt.Errorf("cannot apply replicated put: %w", err)
+			}
+		case EventDelete:
+			if err := applyDelete(e.Key); err != nil && err != ErrorNoSuchKey {
+				return fmt.Errorf("cannot apply replicated delete: %w", err)
+			}
+		}
+		atomic.StoreUint64(&r.lastApplied, e.Sequence)
+	}
+	return rows.Err()
+}
+
+// catchUpFromSnapshot checks whether compaction has advanced the shared
+// events table past what this replica has applied. A replica that's been
+// offline (or stuck in the listener's reconnect window) across a
+// compaction cycle has a lastApplied below the new cutover sequence, but
+// Compact already deleted exactly the rows it still needed - silently
+// resuming the WHERE sequence > lastApplied query would just skip that
+// whole range forever with no error. Instead, when the snapshot is ahead
+// of lastApplied, adopt it wholesale via replaceStore and fast-forward
+// lastApplied to its sequence before querying for anything newer.
+func (r *PostgresReplica) catchUpFromSnapshot(ctx context.Context) error {
+	sequence, state, found, err := r.logger.LoadSnapshot(ctx)
+	if err != nil {
+		return fmt.Errorf("cannot check compaction snapshot: %w", err)
+	}
+	if !found || sequence <= atomic.LoadUint64(&r.lastApplied) {
+		return nil
+	}
+
+	log.Printf("replica fell behind compaction cutover, adopting snapshot at sequence %d", sequence)
+	replaceStore(state)
+	atomic.StoreUint64(&r.lastApplied, sequence)
+	return nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync/atomic"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func init() {
+	RegisterLogger("sqlite", func(dsn string) (TransactionLogger, error) {
+		return newSQLiteTransactionLogger(dsn)
+	})
+}
+
+var sqliteMigrations = []migration{
+	{version: 1, sql: `
+		CREATE TABLE IF NOT EXISTS events (
+			sequence INTEGER PRIMARY KEY AUTOINCREMENT,
+			event_type INTEGER NOT NULL,
+			key TEXT NOT NULL,
+			value TEXT
+		)
+	`},
+}
+
+const sqliteCreateMigrationsTable = `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY
+	)
+`
+const sqliteInsertMigration = `INSERT INTO schema_migrations (version) VALUES (?)`
+
+// SQLiteTransactionLogger writes events one at a time, like
+// FileTransactionLogger; sqlite's single-writer model makes batching as
+// unnecessary here as it is important for Postgres.
+type SQLiteTransactionLogger struct {
+	events       chan<- Event
+	errors       <-chan error
+	done         chan struct{}
+	lastSequence uint64
+	db           *sql.DB
+}
+
+func (l *SQLiteTransactionLogger) WriteDelete(key string) {
+	l.events <- Event{EventType: EventDelete, Key: key}
+}
+
+func (l *SQLiteTransactionLogger) WritePut(key, value string) {
+	l.events <- Event{EventType: EventPut, Key: key, Value: value}
+}
+
+func (l *SQLiteTransactionLogger) Err() <-chan error {
+	return l.errors
+}
+
+func (l *SQLiteTransactionLogger) LastSequence() uint64 {
+	return atomic.LoadUint64(&l.lastSequence)
+}
+
+func (l *SQLiteTransactionLogger) Run() {
+	events := make(chan Event, 16)
+	errors := make(chan error, 1)
+	done := make(chan struct{})
+	l.events = events
+	l.errors = errors
+	l.done = done
+
+	go func() {
+		defer close(done)
+		query := `INSERT INTO events (event_type, key, value) VALUES (?, ?, ?)`
+		for e := range events {
+			res, err := l.db.Exec(query, e.EventType, e.Key, e.Value)
+			if err != nil {
+				errors <- err
+				return
+			}
+			if seq, err := res.LastInsertId(); err == nil {
+				atomic.StoreUint64(&l.lastSequence, uint64(seq))
+			}
+		}
+	}()
+}
+
+func (l *SQLiteTransactionLogger) Close(ctx context.Context) error {
+	close(l.events)
+
+	select {
+	case <-l.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	return l.db.Close()
+}
+
+func (l *SQLiteTransactionLogger) ReadEvents() (<-chan Event, <-chan error) {
+	outEvent := make(chan Event)
+	outError := make(chan error, 1)
+
+	go func() {
+		defer close(outEvent)
+		defer close(outError)
+		rows, err := l.db.Query(`SELECT sequence, event_type, key, value FROM events ORDER BY sequence`)
+		if err != nil {
+			outError <- fmt.Errorf("sql query error: %w", err)
+			return
+		}
+		defer rows.Close()
+
+		var e Event
+		for rows.Next() {
+			if err := rows.Scan(&e.Sequence, &e.EventType, &e.Key, &e.Value); err != nil {
+				outError <- fmt.Errorf("error reading row: %w", err)
+				return
+			}
+			atomic.StoreUint64(&l.lastSequence, e.Sequence)
+			outEvent <- e
+		}
+		if err := rows.Err(); err != nil {
+			outError <- fmt.Errorf("transaction log read failure: %w", err)
+			return
+		}
+	}()
+	return outEvent, outError
+}
+
+func newSQLiteTransactionLogger(dsn string) (TransactionLogger, error) {
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open db: %w", err)
+	}
+
+	if err := db.Ping(); err != nil {
+		return nil, fmt.Errorf("failed to open db connection: %w", err)
+	}
+
+	if err := applyMigrations(db, sqliteCreateMigrationsTable, sqliteInsertMigration, sqliteMigrations); err != nil {
+		return nil, fmt.Errorf("cannot migrate events schema: %w", err)
+	}
+
+	return &SQLiteTransactionLogger{db: db}, nil
+}
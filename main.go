@@ -1,273 +1,69 @@
 package main
 
 import (
-	"bufio"
-	"database/sql"
-	"errors"
+	"context"
+	"flag"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
 	"os"
-	"sync"
-
-	_ "github.com/lib/pq"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/gorilla/mux"
 )
 
-///// Event /////
-
-type Event struct {
-	Sequence  uint64
-	EventType EventType
-	Key       string
-	Value     string
-}
-
-type EventType byte
-
-const (
-	_ = iota
-	EventDelete
-	EventPut
-)
-
-//////TransactionLogger/////
-
-type TransactionLogger interface {
-	WriteDelete(key string)
-	WritePut(key, value string)
-	Err() <-chan error
-	Run()
-	ReadEvents() (<-chan Event, <-chan error)
-}
-
-// // PgSQL ////
-type PostgresDBParams struct {
-	dbName   string
-	host     string
-	user     string
-	password string
-}
-
-type PostgresTransactionLogger struct {
-	events chan<- Event
-	errors <-chan error
-	db     *sql.DB
-}
-
-func (l *PostgresTransactionLogger) WriteDelete(key string) {
-	l.events <- Event{EventType: EventDelete, Key: key}
-}
-
-func (l *PostgresTransactionLogger) WritePut(key, value string) {
-	l.events <- Event{EventType: EventPut, Key: key, Value: value}
-}
-
-func (l *PostgresTransactionLogger) Err() <-chan error {
-	return l.errors
-}
-
-func (l *PostgresTransactionLogger) verifyTableExists() (bool, error) {
-
-	var exists bool
-	err := l.db.QueryRow(`
-		SELECT EXISTS (
-			SELECT FROM information_schema.tables 
-			WHERE table_schema = 'public' 
-			AND table_name = 'events'
-		);
-	`).Scan(&exists)
-
-	if err != nil {
-		log.Fatalf("failed to check if events table exists: %v", err)
-		return false, err
-	}
-
-	if !exists {
-		_, err = l.db.Exec(`
-			CREATE TABLE events (
-				sequence SERIAL PRIMARY KEY,
-				event_type SMALLINT NOT NULL,
-				key TEXT NOT NULL,
-				value TEXT
-			);
-		`)
-		if err != nil {
-			log.Fatalf("cannot create events table: %v", err)
-			return false, err
-		}
-	}
-	return exists, nil
-}
-
-func (l *PostgresTransactionLogger) Run() {
-	events := make(chan Event, 16)
-	errors := make(chan error, 1)
-	l.events = events
-	l.errors = errors
-
-	go func() {
-		query := `INSERT INTO events (event_type, key, value) VALUES ($1, $2, $3)`
-		for e := range events {
-			_, err := l.db.Exec(query, e.EventType, e.Key, e.Value)
-			if err != nil {
-				errors <- err
-				return
-			}
-		}
-	}()
-}
-
-func (l *PostgresTransactionLogger) ReadEvents() (<-chan Event, <-chan error) {
-	outEvent := make(chan Event)
-	outError := make(chan error, 1)
-
-	go func() {
-		defer close(outEvent)
-		defer close(outError)
-		query := `SELECT sequence, event_type, key, value FROM events ORDER BY sequence`
-		rows, err := l.db.Query(query)
-		if err != nil {
-			outError <- fmt.Errorf("sql query error: %w", err)
-			return
-		}
-		defer rows.Close()
-
-		var e Event
-		for rows.Next() {
-			err := rows.Scan(&e.Sequence, &e.EventType, &e.Key, &e.Value)
-			if err != nil {
-				outError <- fmt.Errorf("error reading row: %w", err)
-				return
-			}
-			outEvent <- e
-		}
-		if err = rows.Err(); err != nil {
-			outError <- fmt.Errorf("transaction log read failure: %w", err)
-			return
-		}
-	}()
-	return outEvent, outError
-}
-
-func NewPostgresTransactionLogger(config PostgresDBParams) (TransactionLogger, error) {
-	connStr := fmt.Sprintf("host=%s dbname=%s user=%s password=%s sslmode=disable",
-		config.host, config.dbName, config.user, config.password)
+///LOGGER/////
 
-	db, err := sql.Open("postgres", connStr)
+var logger TransactionLogger
 
-	if err != nil {
-		return nil, fmt.Errorf("failed to open db: %w", err)
+// resolveBackend decides which <driver>://<dsn> backend to use: backendFlag
+// takes priority over the CLOUDGO_BACKEND environment variable, which
+// defaults to the file backend for backward compatibility with earlier
+// cloudgo configs. A value with no "://" is treated as a bare file path.
+func resolveBackend(backendFlag string) (driver, dsn string) {
+	raw := os.Getenv("CLOUDGO_BACKEND")
+	if backendFlag != "" {
+		raw = backendFlag
 	}
-
-	if err = db.Ping(); err != nil {
-		return nil, fmt.Errorf("failed to open db connection: %w", err)
+	if raw == "" {
+		raw = "file://transaction.log"
 	}
-	logger := &PostgresTransactionLogger{db: db}
 
-	_, err = logger.verifyTableExists()
-
-	if err != nil {
-		return nil, fmt.Errorf("cannot create events table: %w", err)
+	driver, dsn, ok := strings.Cut(raw, "://")
+	if !ok {
+		return "file", raw
 	}
-	return logger, nil
-}
-
-/////FileTransactionLogger/////
-
-type FileTransactionLogger struct {
-	events       chan<- Event
-	errors       <-chan error
-	lastSequence uint64
-	file         *os.File
-}
-
-func (l *FileTransactionLogger) WriteDelete(key string) {
-	l.events <- Event{EventType: EventDelete, Key: key}
-}
-
-func (l *FileTransactionLogger) WritePut(key, value string) {
-	l.events <- Event{EventType: EventPut, Key: key, Value: value}
-}
-
-func (l *FileTransactionLogger) Err() <-chan error {
-	return l.errors
+	return driver, dsn
 }
 
-func NewFileTransactionLogger(fileName string) (TransactionLogger, error) {
-	file, err := os.OpenFile(fileName, os.O_CREATE|os.O_APPEND|os.O_RDWR, os.ModePerm)
+// inizializeTransactionLogger opens the named backend, loads its latest
+// compaction snapshot (if any) to bound how much it has to replay, and
+// then replays only the events after that snapshot before letting the
+// logger accept new writes via Run.
+func inizializeTransactionLogger(driver, dsn string) error {
+	var err error
+	logger, err = OpenLogger(driver, dsn)
 	if err != nil {
-		return nil, fmt.Errorf("cannot open transaction log file: %w", err)
+		return fmt.Errorf("failed to create event logger: %w", err)
 	}
-	///TODO:: проверить дескриптор файла
-	return &FileTransactionLogger{file: file}, nil
-}
-
-func (l *FileTransactionLogger) Run() {
-	events := make(chan Event, 16)
-	errors := make(chan error, 1)
-	l.events = events
-	l.errors = errors
 
-	go func() {
-		for e := range events {
-			l.lastSequence++
-
-			_, err := fmt.Fprintf(l.file, "%d\t%d\t%s\t%s\n", l.lastSequence, e.EventType, e.Key, e.Value)
-			if err != nil {
-				errors <- err
-				return
-			}
+	var baseSequence uint64
+	if loader, ok := logger.(SnapshotLoader); ok {
+		sequence, state, found, err := loader.LoadSnapshot(context.Background())
+		if err != nil {
+			return fmt.Errorf("failed to load compaction snapshot: %w", err)
 		}
-	}()
-}
-
-func (l *FileTransactionLogger) ReadEvents() (<-chan Event, <-chan error) {
-	scanner := bufio.NewScanner(l.file)
-	outEvent := make(chan Event)
-	outError := make(chan error, 1)
-
-	go func() {
-		var e Event
-		defer close(outEvent)
-		defer close(outError)
-
-		for scanner.Scan() {
-			line := scanner.Text()
-			if line == io.EOF.Error() {
-				continue
-			}
-			_, err := fmt.Sscanf(line, "%d\t%d\t%s\t%v", &e.Sequence, &e.EventType, &e.Key, &e.Value)
-
-			if err != nil {
-				outError <- fmt.Errorf("input parse error %q: %w", line, err)
-				return
-			}
-
-			if l.lastSequence >= e.Sequence {
-				outError <- fmt.Errorf("input parse error %q: sequence not increasing", line)
-				return
+		if found {
+			for k, v := range state {
+				if err := applyPut(k, v); err != nil {
+					return fmt.Errorf("failed to restore snapshot key %q: %w", k, err)
+				}
 			}
-			l.lastSequence = e.Sequence
-
-			outEvent <- e
+			baseSequence = sequence
 		}
-		if err := scanner.Err(); err != nil {
-			outError <- fmt.Errorf("transaction log read failure: %w", err)
-			return
-
-		}
-	}()
-	return outEvent, outError
-}
-
-func inizializeTransactionLogger() error {
-	var err error
-	logger, err = NewFileTransactionLogger("transaction.log")
-	if err != nil {
-		return fmt.Errorf("failed to create event logger: %w", err)
 	}
 
 	events, errors := logger.ReadEvents()
@@ -277,11 +73,14 @@ func inizializeTransactionLogger() error {
 		select {
 		case err, ok = <-errors:
 		case e, ok = <-events:
+			if !ok || e.Sequence <= baseSequence {
+				continue
+			}
 			switch e.EventType {
 			case EventPut:
-				err = Put(e.Key, e.Value)
+				err = applyPut(e.Key, e.Value)
 			case EventDelete:
-				err = Delete(e.Key)
+				err = applyDelete(e.Key)
 			default:
 				err = fmt.Errorf("unknown event type: %d", e.EventType)
 			}
@@ -295,94 +94,69 @@ func inizializeTransactionLogger() error {
 	return err
 }
 
-///LOGGER/////
-
-var logger TransactionLogger
+func main() {
+	backendFlag := flag.String("backend", "", "storage backend as <driver>://<dsn> (file, memory, postgres, mysql, sqlite); overrides CLOUDGO_BACKEND")
+	compactInterval := flag.Duration("compact-interval", 0, "how often to check whether the transaction log needs compacting (0 disables background compaction)")
+	compactMaxSize := flag.Int64("compact-max-size", 0, "only compact once the transaction log reaches this many bytes (0 compacts on every --compact-interval tick)")
+	replicateFlag := flag.Bool("replicate", false, "join a Postgres-backed replicated cluster: listen for other nodes' writes and contend for the single-writer advisory lock (postgres backend only)")
+	flag.Parse()
 
-// //////STORE//////////
-var ErrorNoSuchKey = errors.New("no such key")
+	driver, dsn := resolveBackend(*backendFlag)
 
-var store = struct {
-	sync.RWMutex
-	m map[string]string
-}{m: make(map[string]string)}
+	if err := inizializeTransactionLogger(driver, dsn); err != nil {
+		log.Fatalf("Failed to initialize transaction logger: %v", err)
+	}
 
-func Put(key, value string) error {
-	store.Lock()
-	defer store.Unlock()
-	store.m[key] = value
-	return nil
-}
+	bgCtx, bgCancel := context.WithCancel(context.Background())
+	defer bgCancel()
+	startCompactionLoop(bgCtx, *compactInterval, *compactMaxSize)
 
-func Get(key string) (string, error) {
-	store.RLock()
-	defer store.RUnlock()
-	value, ok := store.m[key]
-	if !ok {
-		return "", ErrorNoSuchKey
-	}
-	return value, nil
-}
-func Delete(key string) error {
-	store.Lock()
-	defer store.Unlock()
-	_, ok := store.m[key]
-	if !ok {
-		return ErrorNoSuchKey
+	if *replicateFlag {
+		pgLogger, ok := logger.(*PostgresTransactionLogger)
+		if !ok {
+			log.Fatalf("--replicate requires the postgres backend, got %q", driver)
+		}
+		replica = NewPostgresReplica(pgLogger)
+		go func() {
+			if err := replica.Run(bgCtx, "postgres://"+dsn); err != nil {
+				log.Printf("replication listener stopped: %v", err)
+			}
+		}()
 	}
-	delete(store.m, key)
-	logger.WriteDelete(key)
-	return nil
-}
 
-// ///HANDLERS//////////
-func keyValuePutHandler(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	key := vars["key"]
+	r := mux.NewRouter()
 
-	value, err := io.ReadAll(r.Body)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
+	r.HandleFunc("/v1/key/{key}", keyValuePutHandler).Methods("PUT")
+	r.HandleFunc("/v1/key/{key}", keyValueGetHandler).Methods("GET")
+	r.HandleFunc("/v1/keys", keysListHandler).Methods("GET")
+	r.HandleFunc("/v1/snapshot/{id}/key/{key}", snapshotKeyGetHandler).Methods("GET")
+	r.HandleFunc("/v1/admin/compact", adminCompactHandler).Methods("POST")
 
-	err = Put(key, string(value))
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+	srv := &http.Server{
+		Addr:    ":8080",
+		Handler: r,
 	}
 
-	logger.WritePut(key, string(value))
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("ListenAndServe: %v", err)
+		}
+	}()
 
-	w.WriteHeader(http.StatusCreated)
-}
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	<-stop
 
-func keyValueGetHandler(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	key := vars["key"]
+	bgCancel()
 
-	value, err := Get(key)
-	if err == ErrorNoSuchKey {
-		http.Error(w, err.Error(), http.StatusNotFound)
-		return
-	}
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
 
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(value))
-}
-func main() {
-	errInit := inizializeTransactionLogger()
-	if errInit != nil {
-		log.Fatalf("Failed to initialize transaction logger: %v", errInit)
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("HTTP server shutdown error: %v", err)
 	}
-	r := mux.NewRouter()
 
-	r.HandleFunc("/v1/key/{key}", keyValuePutHandler).Methods("PUT")
-	r.HandleFunc("/v1/key/{key}", keyValueGetHandler).Methods("GET")
-
-	log.Fatal(http.ListenAndServe(":8080", r))
+	if err := logger.Close(ctx); err != nil {
+		log.Printf("transaction logger close error: %v", err)
+	}
 }
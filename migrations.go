@@ -0,0 +1,53 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// migration is a single forward-only schema change, applied at most once
+// and recorded in a driver's migrations table.
+type migration struct {
+	version int
+	sql     string
+}
+
+// applyMigrations makes sure createMigrationsTable exists, then runs every
+// migration whose version is greater than the highest one already applied,
+// each inside its own transaction alongside the bookkeeping insert
+// (insertMigration, a one-placeholder statement taking the version). This
+// gives every SQL-backed driver a create-if-not-exists-and-migrate startup
+// path instead of replaying raw DDL on every boot.
+func applyMigrations(db *sql.DB, createMigrationsTable, insertMigration string, migrations []migration) error {
+	if _, err := db.Exec(createMigrationsTable); err != nil {
+		return fmt.Errorf("cannot create schema_migrations table: %w", err)
+	}
+
+	var current int
+	if err := db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return fmt.Errorf("cannot read schema version: %w", err)
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			return fmt.Errorf("cannot begin migration %d: %w", m.version, err)
+		}
+		if _, err := tx.Exec(m.sql); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d failed: %w", m.version, err)
+		}
+		if _, err := tx.Exec(insertMigration, m.version); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("cannot record migration %d: %w", m.version, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("cannot commit migration %d: %w", m.version, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// //////STORE//////////
+var ErrorNoSuchKey = errors.New("no such key")
+
+var store = struct {
+	sync.RWMutex
+	m map[string]string
+}{m: make(map[string]string)}
+
+func Put(key, value string) error {
+	return applyPut(key, value)
+}
+
+func Get(key string) (string, error) {
+	store.RLock()
+	defer store.RUnlock()
+	value, ok := store.m[key]
+	if !ok {
+		return "", ErrorNoSuchKey
+	}
+	return value, nil
+}
+
+func Delete(key string) error {
+	if err := applyDelete(key); err != nil {
+		return err
+	}
+	logger.WriteDelete(key)
+	return nil
+}
+
+// applyPut and applyDelete mutate the store directly, with no transaction
+// log write. Delete logs its event itself; Put does not (keyValuePutHandler
+// calls logger.WritePut after it). Use these instead of Delete, or of the
+// PUT handler's Put-then-WritePut, when the event is already durable
+// somewhere else and logging it again would be redundant at best:
+// replaying a backend's own log at startup, or applying an event another
+// node in a replicated cluster already wrote.
+func applyPut(key, value string) error {
+	store.Lock()
+	defer store.Unlock()
+	store.m[key] = value
+	return nil
+}
+
+func applyDelete(key string) error {
+	store.Lock()
+	defer store.Unlock()
+	if _, ok := store.m[key]; !ok {
+		return ErrorNoSuchKey
+	}
+	delete(store.m, key)
+	return nil
+}
+
+// replaceStore swaps the store's contents for state wholesale, discarding
+// whatever was there before. Unlike applyPut/applyDelete, which assume
+// they're filling in events one at a time, this is for a caller that has
+// to adopt a point-in-time snapshot outright - e.g. a replication catch-up
+// that fell behind a compaction cutover and can no longer reconstruct the
+// missing range event-by-event.
+func replaceStore(state map[string]string) {
+	store.Lock()
+	defer store.Unlock()
+	store.m = make(map[string]string, len(state))
+	for k, v := range state {
+		store.m[k] = v
+	}
+}
+
+// snapshotForCompaction clones the store and reports the log sequence the
+// clone is guaranteed to already reflect, both read while holding the same
+// RLock. Sequence assignment always happens after the corresponding
+// store mutation (WritePut/WriteDelete are only called once applyPut/
+// applyDelete already returned), so reading logger.LastSequence() before
+// releasing the lock guarantees every sequence it reports was mutated into
+// the store strictly before the clone was taken - no write can land
+// between the two reads and make the clone stale relative to the chosen
+// cutover. Compact must never be called with a (sequence, state) pair
+// gathered any other way: a sequence read after the clone could already
+// cover an event the clone doesn't have yet, and compacting on it would
+// silently drop that event for good.
+func snapshotForCompaction() (sequence uint64, state map[string]string) {
+	store.RLock()
+	defer store.RUnlock()
+
+	sequence = logger.LastSequence()
+	state = make(map[string]string, len(store.m))
+	for k, v := range store.m {
+		state[k] = v
+	}
+	return sequence, state
+}
+
+// //////SNAPSHOT//////////
+var ErrorNoSuchSnapshot = errors.New("no such snapshot")
+
+// snapshotTTL bounds how long a client-pinned Snapshot is kept around for
+// GetSnapshotByID before it's treated as expired and evicted. Without a
+// TTL, every /v1/keys call would pin another full copy of the store in
+// the snapshots map forever.
+const snapshotTTL = 5 * time.Minute
+
+// Snapshot is a point-in-time, read-only view of the store. It lets a
+// client page through a prefix scan or issue several multi-gets without
+// observing Puts/Deletes that happen concurrently.
+type Snapshot struct {
+	id        string
+	data      map[string]string
+	expiresAt time.Time
+}
+
+// Get reads key as it stood when the snapshot was taken.
+func (s *Snapshot) Get(key string) (string, error) {
+	value, ok := s.data[key]
+	if !ok {
+		return "", ErrorNoSuchKey
+	}
+	return value, nil
+}
+
+// Keys returns the snapshot's keys matching prefix, sorted for stable
+// pagination.
+func (s *Snapshot) Keys(prefix string) []string {
+	keys := make([]string, 0, len(s.data))
+	for k := range s.data {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+var snapshotSeq uint64
+
+var snapshots = struct {
+	sync.Mutex
+	m map[string]*Snapshot
+}{m: make(map[string]*Snapshot)}
+
+// NewSnapshot clones the store under an RLock, so writers are held off
+// only while the copy is made, and pins the clone server-side under a
+// generated id so a client can come back for more keys/values with a
+// stable view via GetSnapshotByID(id). Pinned snapshots expire after snapshotTTL; each call
+// sweeps expired ones so the snapshots map can't grow without bound under
+// ordinary /v1/keys traffic.
+func NewSnapshot() *Snapshot {
+	store.RLock()
+	data := make(map[string]string, len(store.m))
+	for k, v := range store.m {
+		data[k] = v
+	}
+	store.RUnlock()
+
+	now := time.Now()
+	id := fmt.Sprintf("%d", atomic.AddUint64(&snapshotSeq, 1))
+	snap := &Snapshot{id: id, data: data, expiresAt: now.Add(snapshotTTL)}
+
+	snapshots.Lock()
+	defer snapshots.Unlock()
+	snapshots.m[id] = snap
+	evictExpiredSnapshots(now)
+
+	return snap
+}
+
+// evictExpiredSnapshots drops snapshots whose TTL has passed. Callers must
+// hold snapshots.Mutex.
+func evictExpiredSnapshots(now time.Time) {
+	for id, snap := range snapshots.m {
+		if now.After(snap.expiresAt) {
+			delete(snapshots.m, id)
+		}
+	}
+}
+
+// GetSnapshotByID looks up a previously pinned snapshot by id. An expired
+// snapshot is treated the same as one that was never pinned.
+func GetSnapshotByID(id string) (*Snapshot, error) {
+	snapshots.Lock()
+	defer snapshots.Unlock()
+
+	snap, ok := snapshots.m[id]
+	if !ok || time.Now().After(snap.expiresAt) {
+		delete(snapshots.m, id)
+		return nil, ErrorNoSuchSnapshot
+	}
+	return snap, nil
+}